@@ -1,17 +1,45 @@
-package wp
+package workerpool
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type WorkerPool interface {
-	Submit(ctx context.Context, task *Task, opts ...TaskOption) error
+	Submit(ctx context.Context, task *Task, opts ...TaskOption) (*TaskHandle, error)
+	// WaitForTask 阻塞等待指定 id 的任务完成并返回其结果,ctx 被取消时返回 ctx.Err()
+	//  仅当任务的 handler 通过 RegisterTaskHandlerWithResult 注册时才会产生可等待的结果
+	WaitForTask(ctx context.Context, id string) (*TaskResult, error)
 	Run() error
 	Stop() error
 	Resize(workerSize uint32) error
+	// Stats 返回运行时统计信息,供管理接口使用
+	Stats() PoolStats
+	// FlushQueues 停止接受新的 Submit 调用,并阻塞等待所有队列排空;nonBlocking 为 true 时立即返回
+	FlushQueues(ctx context.Context, timeout time.Duration, nonBlocking bool) error
+	// Pause 使指定队列停止被出队,入队不受影响
+	Pause(queue string) error
+	// Resume 恢复指定队列的出队
+	Resume(queue string) error
+	// HandlerKeys 返回所有已注册的任务处理器 key
+	HandlerKeys() []string
 }
 
 type Worker interface {
 	Run() error
 	Stop() error
+	// IdleFor 返回距离上一次成功出队任务的时长
+	IdleFor() time.Duration
+	// Busy 返回该工作协程当前是否正在执行任务
+	Busy() bool
+	// Stats 返回该工作协程累计处理/失败的任务数
+	Stats() WorkerStats
+}
+
+// WorkerStats 单个工作协程的累计统计信息
+type WorkerStats struct {
+	Processed int64
+	Failed    int64
 }
 
 type TaskQueue interface {
@@ -19,6 +47,8 @@ type TaskQueue interface {
 	Enqueue(ctx context.Context, task *Task) error
 	// Dequeue 出队,队列已满时返回 ErrTaskQueueFull 错误
 	Dequeue(ctx context.Context) (task *Task, err error)
+	// Len 返回队列中当前待处理的任务数
+	Len(ctx context.Context) (int, error)
 }
 
 type Logger interface {
@@ -0,0 +1,227 @@
+package workerpool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PoolStats 运行时统计信息,由 WorkerPool.Stats 返回,供运维场景下的自检/监控接入
+type PoolStats struct {
+	// QueueDepths 每个队列当前的待处理任务数,key 为 WorkerPoolConfig.TaskQueues 的队列名
+	QueueDepths map[string]int
+	// HandlerInFlight 每个 handler key 当前正在执行的任务数
+	HandlerInFlight map[string]int64
+	// WorkersAlive 当前存活的工作协程数
+	WorkersAlive int
+	// WorkersIdle 当前空闲(未在执行任务)的工作协程数
+	WorkersIdle int
+	// TasksProcessed 当前存活的工作协程累计处理的任务数(含失败),已被回收或缩容移除的工作协程不计入
+	TasksProcessed int64
+	// TasksFailed 当前存活的工作协程累计处理失败的任务数,已被回收或缩容移除的工作协程不计入
+	TasksFailed int64
+}
+
+// Stats 返回当前运行时统计信息,用于管理接口或自监控
+func (p *workerPool) Stats() PoolStats {
+	p.mutex.Lock()
+	workers := make([]Worker, len(p.workers))
+	copy(workers, p.workers)
+	p.mutex.Unlock()
+
+	stats := PoolStats{
+		QueueDepths:     make(map[string]int, len(p.conf.TaskQueues)),
+		HandlerInFlight: make(map[string]int64),
+		WorkersAlive:    len(workers),
+	}
+
+	ctx := p.conf.NewContext()
+	for name, queue := range p.conf.TaskQueues {
+		depth, err := queue.Len(ctx)
+		if err != nil {
+			p.conf.Logger.Warn(ctx, "stats: failed to read depth of queue %q: %v", name, err)
+			continue
+		}
+		stats.QueueDepths[name] = depth
+	}
+
+	for _, w := range workers {
+		ws := w.Stats()
+		stats.TasksProcessed += ws.Processed
+		stats.TasksFailed += ws.Failed
+		if !w.Busy() {
+			stats.WorkersIdle++
+		}
+	}
+
+	p.conf.handlerInFlight.Range(func(key, value any) bool {
+		stats.HandlerInFlight[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+
+	return stats
+}
+
+// FlushQueues 停止接受新的 Submit 调用,并阻塞等待所有队列排空;排空后自动恢复接受新任务。
+// nonBlocking 为 true 时置位停止接受后立即返回,在后台等待排空(或超时)后再恢复接受新任务;
+// timeout 为 0 时取 WorkerPoolConfig.GracefulShutdownTimeout 作为默认超时
+func (p *workerPool) FlushQueues(ctx context.Context, timeout time.Duration, nonBlocking bool) error {
+	p.accepting.Store(false)
+
+	if nonBlocking {
+		go func() { _ = p.FlushQueues(p.conf.NewContext(), timeout, false) }()
+		return nil
+	}
+	defer p.accepting.Store(true)
+	if timeout == 0 {
+		timeout = p.conf.GracefulShutdownTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if p.queuesDrained(ctx) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("flush queues timeout")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// delayedLenQueue 由支持延迟/定时任务的 TaskQueue 实现提供,queuesDrained 借此探测尚未到期、
+// 不计入 Len 的延迟任务,非所有 TaskQueue 实现都需要支持
+type delayedLenQueue interface {
+	delayedLen(ctx context.Context) (int, error)
+}
+
+// queuesDrained 返回是否所有队列均已真正排空:就绪任务数为零、尚未到期的延迟任务数为零,
+// 且没有任何 handler 仍在执行中
+func (p *workerPool) queuesDrained(ctx context.Context) bool {
+	inFlight := true
+	p.conf.handlerInFlight.Range(func(_, value any) bool {
+		if value.(*atomic.Int64).Load() > 0 {
+			inFlight = false
+			return false
+		}
+		return true
+	})
+	if !inFlight {
+		return false
+	}
+
+	for name, queue := range p.conf.TaskQueues {
+		depth, err := queue.Len(ctx)
+		if err != nil {
+			p.conf.Logger.Warn(ctx, "flush queues: failed to read depth of queue %q: %v", name, err)
+			return false
+		}
+		if depth > 0 {
+			return false
+		}
+
+		if dq, ok := queue.(delayedLenQueue); ok {
+			delayedDepth, err := dq.delayedLen(ctx)
+			if err != nil {
+				p.conf.Logger.Warn(ctx, "flush queues: failed to read delayed depth of queue %q: %v", name, err)
+				return false
+			}
+			if delayedDepth > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Pause 使指定队列停止被出队,入队不受影响;queue 不存在时返回 ErrTaskQueueNotFound
+func (p *workerPool) Pause(queue string) error {
+	if !p.conf.priorityTaskQueue.setPaused(queue, true) {
+		return errors.WithStack(ErrTaskQueueNotFound)
+	}
+	return nil
+}
+
+// Resume 恢复指定队列的出队;queue 不存在时返回 ErrTaskQueueNotFound
+func (p *workerPool) Resume(queue string) error {
+	if !p.conf.priorityTaskQueue.setPaused(queue, false) {
+		return errors.WithStack(ErrTaskQueueNotFound)
+	}
+	return nil
+}
+
+// HandlerKeys 返回所有已注册的任务处理器 key,含带返回值与不带返回值两类
+func (p *workerPool) HandlerKeys() []string {
+	keys := make([]string, 0, len(taskHandlers)+len(taskHandlersWithResult))
+	for key := range taskHandlers {
+		keys = append(keys, key)
+	}
+	for key := range taskHandlersWithResult {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// NewAdminHandler 返回一个可挂载到调用方 HTTP 服务上的管理接口,以 JSON 暴露 pool 的运行时状态:
+//
+//	GET  /stats    Stats() 结果
+//	GET  /handlers HandlerKeys() 结果
+//	POST /flush?timeout=5s&non_blocking=true
+//	POST /pause?queue=xxx
+//	POST /resume?queue=xxx
+func NewAdminHandler(pool WorkerPool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, pool.Stats())
+	})
+
+	mux.HandleFunc("/handlers", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, pool.HandlerKeys())
+	})
+
+	mux.HandleFunc("/flush", func(w http.ResponseWriter, r *http.Request) {
+		timeout, _ := time.ParseDuration(r.URL.Query().Get("timeout"))
+		nonBlocking := r.URL.Query().Get("non_blocking") == "true"
+		if err := pool.FlushQueues(r.Context(), timeout, nonBlocking); err != nil {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if err := pool.Pause(r.URL.Query().Get("queue")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if err := pool.Resume(r.URL.Query().Get("queue")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,98 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Metrics 用于观测任务执行耗时,可对接 Prometheus 等指标系统
+type Metrics interface {
+	ObserveTaskDuration(key string, status string, duration time.Duration)
+}
+
+type taskIDContextKey struct{}
+
+// TaskIDFromContext 取出由 TaskIDContextMiddleware 注入的任务 ID
+func TaskIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(taskIDContextKey{}).(string)
+	return id, ok
+}
+
+// RecoverMiddleware 捕获 handler 执行期间的 panic 并转换为 error,避免其导致 worker 所在的
+// goroutine 崩溃退出;NewWorkerPool 会默认将其置于所有全局中间件的最外层
+func RecoverMiddleware() TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task *Task) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					if e, ok := r.(error); ok {
+						err = errors.WithStack(e)
+					} else {
+						err = errors.Errorf("panic recovered: %v", r)
+					}
+				}
+			}()
+			return next(ctx, task)
+		}
+	}
+}
+
+// LoggingMiddleware 在任务执行前后通过 logger 记录结构化日志
+func LoggingMiddleware(logger Logger) TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task *Task) error {
+			logger.Info(ctx, "task %s (key=%s) started", task.ID, task.Key)
+
+			err := next(ctx, task)
+			if err != nil {
+				logger.Warn(ctx, "task %s (key=%s) failed: %v", task.ID, task.Key, err)
+			} else {
+				logger.Info(ctx, "task %s (key=%s) succeeded", task.ID, task.Key)
+			}
+			return err
+		}
+	}
+}
+
+// MetricsMiddleware 记录任务执行耗时,status 取值为 "success" 或 "error"
+func MetricsMiddleware(metrics Metrics) TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task *Task) error {
+			start := time.Now()
+			err := next(ctx, task)
+
+			status := "success"
+			if err != nil {
+				status = "error"
+			}
+			metrics.ObserveTaskDuration(task.Key, status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// TaskIDContextMiddleware 将 task.ID 注入 ctx,供 handler 内部通过 TaskIDFromContext 取出
+func TaskIDContextMiddleware() TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task *Task) error {
+			return next(context.WithValue(ctx, taskIDContextKey{}, task.ID), task)
+		}
+	}
+}
+
+// PostTimeoutErrorLoggerMiddleware 在外层 ctx 已结束(超时或取消)、但 handler 最终仍返回
+// 错误时记录日志,避免该错误因 worker 已转入下一轮循环而悄悄丢失(参考 Kitex rpcTimeoutMW
+// 对超时后才完成的请求的处理)。记录日志时使用 context.Background(),因为 ctx 此时可能已结束
+func PostTimeoutErrorLoggerMiddleware(logger Logger) TaskMiddleware {
+	return func(next TaskHandler) TaskHandler {
+		return func(ctx context.Context, task *Task) error {
+			err := next(ctx, task)
+			if err != nil && ctx.Err() != nil {
+				logger.Warn(context.Background(), "task %s (key=%s) failed after its context had already ended: %v", task.ID, task.Key, err)
+			}
+			return err
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package wp
+package workerpool
 
 import (
 	"context"
@@ -7,10 +7,27 @@ import (
 	"github.com/google/uuid"
 )
 
-var taskHandlers = make(map[string]TaskHandler)
+var (
+	taskHandlers           = make(map[string]TaskHandler)
+	taskHandlersWithResult = make(map[string]TaskHandlerWithResult)
+)
 
 type TaskHandler func(ctx context.Context, task *Task) error
 
+// TaskMiddleware 包装 TaskHandler 以在调用前后注入通用逻辑,类似 HTTP 中间件。
+// 见 WorkerPoolConfig.Middlewares 与 RegisterTaskHandlerWithMiddleware
+type TaskMiddleware func(TaskHandler) TaskHandler
+
+// TaskHandlerWithResult 带返回值的任务处理器,通过 RegisterTaskHandlerWithResult 注册后
+// 可配合 WorkerPool.WaitForTask 取回执行结果
+type TaskHandlerWithResult func(ctx context.Context, task *Task) (interface{}, error)
+
+// TaskResult 任务执行结果,由 WaitForTask 返回
+type TaskResult struct {
+	Value interface{}
+	Err   error
+}
+
 type Task struct {
 	TaskOptions
 	ID  string `json:"id"`
@@ -21,6 +38,15 @@ type TaskOptions struct {
 	Payload []byte        `json:"payload"`
 	Timeout time.Duration `json:"timeout"`
 	Queue   string        `json:"queue"`
+	// ProcessAt 任务最早可被执行的时间,零值表示立即可执行
+	ProcessAt time.Time `json:"process_at"`
+	// MaxRetries 任务失败后的最大重试次数,默认为 0 表示不重试
+	MaxRetries int `json:"max_retries"`
+	// Attempt 当前已重试次数,由 worker 在每次重试时递增
+	Attempt int `json:"attempt"`
+	// RetryBackoff 计算第 attempt 次重试延迟时间的退避函数,不参与 JSON 序列化
+	//  任务经由 RedisTaskQueue 重新入队后会丢失该字段,此时回退到 WorkerPoolConfig.DefaultRetryBackoff
+	RetryBackoff func(attempt int) time.Duration `json:"-"`
 }
 
 type TaskOption func(*TaskOptions)
@@ -43,6 +69,35 @@ func WithTaskQueue(queue string) TaskOption {
 	}
 }
 
+// WithTaskDelay 设置任务延迟 d 之后才可被执行,以调用时刻为基准计算 ProcessAt
+func WithTaskDelay(d time.Duration) TaskOption {
+	return func(opts *TaskOptions) {
+		opts.ProcessAt = time.Now().Add(d)
+	}
+}
+
+// WithTaskProcessAt 设置任务最早可被执行的时间点
+func WithTaskProcessAt(t time.Time) TaskOption {
+	return func(opts *TaskOptions) {
+		opts.ProcessAt = t
+	}
+}
+
+// WithTaskMaxRetries 设置任务失败后的最大重试次数,默认为 0 表示不重试
+func WithTaskMaxRetries(n int) TaskOption {
+	return func(opts *TaskOptions) {
+		opts.MaxRetries = n
+	}
+}
+
+// WithTaskRetryBackoff 设置计算第 attempt 次重试延迟时间的退避函数
+// 仅在内存队列场景下随 task 传递,Redis 队列场景请使用 WorkerPoolConfig.DefaultRetryBackoff
+func WithTaskRetryBackoff(f func(attempt int) time.Duration) TaskOption {
+	return func(opts *TaskOptions) {
+		opts.RetryBackoff = f
+	}
+}
+
 func NewTask(key string, opts ...TaskOption) *Task {
 	o := TaskOptions{
 		Queue:   "default",
@@ -61,6 +116,43 @@ func RegisterTaskHandler(key string, handler TaskHandler) {
 	taskHandlers[key] = handler
 }
 
+// RegisterTaskHandlerWithMiddleware 注册一个任务处理器,并在其外层按声明顺序叠加 mws,
+// 即 mws[0] 最外层、最先执行,handler 本身最后执行。WorkerPoolConfig.Middlewares 中的
+// 全局中间件会在 NewWorkerPool 时再叠加到最外层
+func RegisterTaskHandlerWithMiddleware(key string, handler TaskHandler, mws ...TaskMiddleware) {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	RegisterTaskHandler(key, handler)
+}
+
+// RegisterTaskHandlerWithResult 注册一个带返回值的任务处理器,与 RegisterTaskHandler 互斥,
+// 同一个 key 只应注册其中一种。NewWorkerPool 会为其套用与普通 handler 相同的全局中间件
+func RegisterTaskHandlerWithResult(key string, handler TaskHandlerWithResult) {
+	taskHandlersWithResult[key] = handler
+}
+
+// wrapResultHandlerMiddlewares 将 mws 按与 TaskHandler 相同的组合顺序套用在一个
+// TaskHandlerWithResult 上,通过内部闭包桥接到 TaskHandler 签名以复用同一套 TaskMiddleware
+func wrapResultHandlerMiddlewares(handler TaskHandlerWithResult, mws []TaskMiddleware) TaskHandlerWithResult {
+	return func(ctx context.Context, task *Task) (interface{}, error) {
+		var value interface{}
+		bridge := func(ctx context.Context, task *Task) error {
+			var err error
+			value, err = handler(ctx, task)
+			return err
+		}
+		for i := len(mws) - 1; i >= 0; i-- {
+			bridge = mws[i](bridge)
+		}
+		return value, bridge(ctx, task)
+	}
+}
+
 func taskHandler(key string) TaskHandler {
 	return taskHandlers[key]
 }
+
+func taskHandlerWithResult(key string) TaskHandlerWithResult {
+	return taskHandlersWithResult[key]
+}
@@ -1,9 +1,13 @@
-package wp
+package workerpool
 
 import (
+	"container/heap"
 	"context"
 	"encoding/json"
 	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -12,15 +16,31 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// defaultRedisBlockTimeout 调用方 ctx 未设置截止时间时,BRPop 的默认阻塞时长
+const defaultRedisBlockTimeout = 5 * time.Second
+
+// minRedisBlockTimeout ctx 截止时间已过时 BRPop 的阻塞时长下限,避免传入 0 被 Redis 解读为无限阻塞
+const minRedisBlockTimeout = 10 * time.Millisecond
+
 type (
 	// MemoryTaskQueue 本地任务队列
 	MemoryTaskQueue struct {
 		data mpmc.RingBuffer[*Task]
+
+		mutex   sync.Mutex
+		delayed delayedTaskHeap
 	}
 
-	// RedisTaskQueue Redis任务队列
+	// delayedTaskHeap 按 ProcessAt 升序排列的延迟任务小顶堆
+	delayedTaskHeap []*Task
+
+	// RedisTaskQueue Redis任务队列,对应一个 Redis List
 	RedisTaskQueue struct {
-		rdb redis.UniversalClient
+		rdb        redis.UniversalClient
+		key        string
+		delayedKey string
+
+		moveDueTasks *redis.Script
 	}
 
 	queueWithPriority struct {
@@ -31,7 +51,9 @@ type (
 
 	//  优先级任务队列,会优先出队高优任务
 	priorityTaskQueue struct {
-		queues []TaskQueue
+		entries []queueWithPriority
+		// paused 记录每个队列名是否被暂停出队,key 为队列名,value 为 *atomic.Bool
+		paused sync.Map
 	}
 )
 
@@ -46,29 +68,83 @@ func NewMemoryTaskQueue(capacity uint32) *MemoryTaskQueue {
 	}
 }
 
-func NewRedisTaskQueue(rdb redis.UniversalClient) *RedisTaskQueue {
+// NewRedisTaskQueue 创建一个 Redis 任务队列,key 为承载就绪任务的 Redis List 名称,
+// 延迟/定时任务使用 key+":delayed" 作为有序集合名称
+func NewRedisTaskQueue(rdb redis.UniversalClient, key string) *RedisTaskQueue {
 	return &RedisTaskQueue{
-		rdb: rdb,
+		rdb:        rdb,
+		key:        key,
+		delayedKey: key + ":delayed",
+		// 原子地将延迟有序集合中已到期的任务搬到主队列,避免先 ZRANGE 再 LPUSH 的竞态
+		moveDueTasks: redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('LPUSH', KEYS[2], member)
+end
+return #due
+`),
 	}
 }
 
+// Len 返回延迟堆中元素个数,实现 heap.Interface
+func (h delayedTaskHeap) Len() int { return len(h) }
+
+// Less 实现 heap.Interface,按 ProcessAt 升序排序
+func (h delayedTaskHeap) Less(i, j int) bool { return h[i].ProcessAt.Before(h[j].ProcessAt) }
+
+// Swap 实现 heap.Interface
+func (h delayedTaskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Push 实现 heap.Interface
+func (h *delayedTaskHeap) Push(x any) { *h = append(*h, x.(*Task)) }
+
+// Pop 实现 heap.Interface
+func (h *delayedTaskHeap) Pop() any {
+	old := *h
+	n := len(old)
+	task := old[n-1]
+	*h = old[:n-1]
+	return task
+}
+
 func newPriorityTaskQueue(queues ...queueWithPriority) *priorityTaskQueue {
 	// 按优先级降序排序（优先级高的在前）
 	sort.Slice(queues, func(i, j int) bool {
 		return queues[i].Priority > queues[j].Priority
 	})
 
-	taskQueues := make([]TaskQueue, len(queues))
-	for i, queue := range queues {
-		taskQueues[i] = queue.Queue
+	q := &priorityTaskQueue{entries: queues}
+	for _, e := range queues {
+		q.paused.Store(e.Name, new(atomic.Bool))
 	}
+	return q
+}
+
+// isPaused 返回 name 对应的队列当前是否被暂停出队
+func (q *priorityTaskQueue) isPaused(name string) bool {
+	v, ok := q.paused.Load(name)
+	return ok && v.(*atomic.Bool).Load()
+}
 
-	return &priorityTaskQueue{
-		queues: taskQueues,
+// setPaused 设置 name 对应队列的暂停状态,name 不存在时返回 false
+func (q *priorityTaskQueue) setPaused(name string, paused bool) bool {
+	v, ok := q.paused.Load(name)
+	if !ok {
+		return false
 	}
+	v.(*atomic.Bool).Store(paused)
+	return true
 }
 
 func (q *MemoryTaskQueue) Enqueue(_ context.Context, task *Task) error {
+	if task.ProcessAt.After(time.Now()) {
+		q.mutex.Lock()
+		heap.Push(&q.delayed, task)
+		q.mutex.Unlock()
+		return nil
+	}
+
 	err := q.data.Enqueue(task)
 	if errors.Is(err, mpmc.ErrQueueFull) {
 		return errors.WithStack(ErrTaskQueueFull)
@@ -77,6 +153,8 @@ func (q *MemoryTaskQueue) Enqueue(_ context.Context, task *Task) error {
 }
 
 func (q *MemoryTaskQueue) Dequeue(_ context.Context) (*Task, error) {
+	q.moveDueTasks()
+
 	task, err := q.data.Dequeue()
 	if errors.Is(err, mpmc.ErrQueueEmpty) {
 		return nil, errors.WithStack(ErrTaskQueueEmpty)
@@ -84,36 +162,121 @@ func (q *MemoryTaskQueue) Dequeue(_ context.Context) (*Task, error) {
 	return task, nil
 }
 
+// Len 返回环形队列中就绪任务的数量,不包含尚未到期的延迟任务
+func (q *MemoryTaskQueue) Len(_ context.Context) (int, error) {
+	return int(q.data.Size()), nil
+}
+
+// delayedLen 返回延迟堆中尚未到期的任务数,供 FlushQueues 判断队列是否真正排空
+func (q *MemoryTaskQueue) delayedLen(_ context.Context) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.delayed.Len(), nil
+}
+
+// moveDueTasks 把延迟堆中已到期的任务移入就绪环形队列
+func (q *MemoryTaskQueue) moveDueTasks() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	for q.delayed.Len() > 0 && !q.delayed[0].ProcessAt.After(now) {
+		task := heap.Pop(&q.delayed).(*Task)
+		if err := q.data.Enqueue(task); err != nil {
+			// 就绪队列已满,放回延迟堆等待下一次 Dequeue 再尝试
+			heap.Push(&q.delayed, task)
+			break
+		}
+	}
+}
+
 func (q *RedisTaskQueue) Enqueue(ctx context.Context, task *Task) error {
 	data, err := json.Marshal(task)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return q.rdb.LPush(ctx, "task_queue", data).Err()
+	if task.ProcessAt.After(time.Now()) {
+		return q.rdb.ZAdd(ctx, q.delayedKey, redis.Z{
+			Score:  float64(task.ProcessAt.UnixNano()),
+			Member: data,
+		}).Err()
+	}
+
+	return q.rdb.LPush(ctx, q.key, data).Err()
 }
 
+// Dequeue 使用 BRPop 阻塞出队,阻塞时长取自 ctx 截止时间的剩余时长,
+// 避免 RPop 空队列时的零延迟轮询对 Redis 造成持续压力
 func (q *RedisTaskQueue) Dequeue(ctx context.Context) (*Task, error) {
-	result, err := q.rdb.RPop(ctx, "task_queue").Bytes()
+	if err := q.doMoveDueTasks(ctx); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result, err := q.rdb.BRPop(ctx, blockDuration(ctx), q.key).Result()
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
+		if errors.Is(err, redis.Nil) || ctx.Err() != nil {
 			return nil, errors.WithStack(ErrTaskQueueEmpty)
 		}
 		return nil, errors.WithStack(err)
 	}
 
 	task := &Task{}
-	err = json.Unmarshal(result, task)
-	if err != nil {
+	if err := json.Unmarshal([]byte(result[1]), task); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	return task, nil
 }
 
+// Len 返回主队列中就绪任务的数量,不包含尚未到期的延迟任务
+func (q *RedisTaskQueue) Len(ctx context.Context) (int, error) {
+	n, err := q.rdb.LLen(ctx, q.key).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(n), nil
+}
+
+// delayedLen 返回延迟有序集合中尚未到期的任务数,供 FlushQueues 判断队列是否真正排空
+func (q *RedisTaskQueue) delayedLen(ctx context.Context) (int, error) {
+	n, err := q.rdb.ZCard(ctx, q.delayedKey).Result()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return int(n), nil
+}
+
+// doMoveDueTasks 通过 Lua 脚本原子地将延迟有序集合中已到期的任务搬到主队列
+func (q *RedisTaskQueue) doMoveDueTasks(ctx context.Context) error {
+	now := float64(time.Now().UnixNano())
+	return q.moveDueTasks.Run(ctx, q.rdb, []string{q.delayedKey, q.key}, now).Err()
+}
+
+// blockDuration 计算 BRPop 可阻塞的时长:优先取 ctx 截止时间的剩余时长,否则回退到默认值;
+// 截止时间已过时回退到 minRedisBlockTimeout,避免传入 0 被 Redis 解读为无限阻塞
+func blockDuration(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultRedisBlockTimeout
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		return remaining
+	}
+	return minRedisBlockTimeout
+}
+
 func (q *priorityTaskQueue) Dequeue(ctx context.Context) (*Task, error) {
-	for _, queue := range q.queues {
-		task, err := queue.Dequeue(ctx)
+	if task, err, handled := q.dequeueRedisBatch(ctx); handled {
+		return task, err
+	}
+
+	for _, e := range q.entries {
+		if q.isPaused(e.Name) {
+			continue // 已暂停的队列跳过出队,入队不受影响
+		}
+
+		task, err := e.Queue.Dequeue(ctx)
 		if err != nil {
 			if errors.Is(err, ErrTaskQueueEmpty) {
 				continue // Try next queue
@@ -124,3 +287,47 @@ func (q *priorityTaskQueue) Dequeue(ctx context.Context) (*Task, error) {
 	}
 	return nil, errors.WithStack(ErrTaskQueueEmpty) // All queues are empty
 }
+
+// dequeueRedisBatch 当所有队列都是共享同一个 Redis 客户端的 RedisTaskQueue 时,
+// 用一次 BRPop 按优先级顺序跨所有未暂停的队列出队,取代逐队列轮询造成的多次往返;
+// handled 为 false 表示队列集合不满足该条件,调用方应回退到逐队列轮询
+func (q *priorityTaskQueue) dequeueRedisBatch(ctx context.Context) (task *Task, err error, handled bool) {
+	if len(q.entries) == 0 {
+		return nil, nil, false
+	}
+
+	keys := make([]string, 0, len(q.entries))
+	var rdb redis.UniversalClient
+	for _, e := range q.entries {
+		rq, ok := e.Queue.(*RedisTaskQueue)
+		if !ok || (rdb != nil && rq.rdb != rdb) {
+			return nil, nil, false
+		}
+		rdb = rq.rdb
+		if q.isPaused(e.Name) {
+			continue // 已暂停的队列不参与本次 BRPop
+		}
+		if err := rq.doMoveDueTasks(ctx); err != nil {
+			return nil, errors.WithStack(err), true
+		}
+		keys = append(keys, rq.key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.WithStack(ErrTaskQueueEmpty), true
+	}
+
+	result, err := rdb.BRPop(ctx, blockDuration(ctx), keys...).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+			return nil, errors.WithStack(ErrTaskQueueEmpty), true
+		}
+		return nil, errors.WithStack(err), true
+	}
+
+	task = &Task{}
+	if err := json.Unmarshal([]byte(result[1]), task); err != nil {
+		return nil, errors.WithStack(err), true
+	}
+	return task, nil, true
+}
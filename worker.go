@@ -1,4 +1,4 @@
-package wp
+package workerpool
 
 import (
 	"context"
@@ -10,19 +10,44 @@ import (
 )
 
 type worker struct {
-	conf    *WorkerPoolConfig
-	running atomic.Bool
-	stopCh  chan struct{}
-	wg      sync.WaitGroup
+	conf         *WorkerPoolConfig
+	running      atomic.Bool
+	stopCh       chan struct{}
+	wg           sync.WaitGroup
+	lastActiveAt atomic.Int64
+
+	busy      atomic.Bool
+	processed atomic.Int64
+	failed    atomic.Int64
 }
 
 var _ Worker = &worker{}
 
 func newWorker(conf *WorkerPoolConfig) *worker {
-	return &worker{
+	w := &worker{
 		conf:   conf,
 		stopCh: make(chan struct{}),
 	}
+	w.lastActiveAt.Store(time.Now().UnixNano())
+	return w
+}
+
+// IdleFor 返回距离上一次成功出队任务的时长,用于哨兵协程判断是否需要回收该工作协程
+func (w *worker) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, w.lastActiveAt.Load()))
+}
+
+// Busy 返回该工作协程当前是否正在执行任务,供 Stats 统计在线/空闲工作协程数使用
+func (w *worker) Busy() bool {
+	return w.busy.Load()
+}
+
+// Stats 返回该工作协程累计处理/失败的任务数
+func (w *worker) Stats() WorkerStats {
+	return WorkerStats{
+		Processed: w.processed.Load(),
+		Failed:    w.failed.Load(),
+	}
 }
 
 func (w *worker) Run() error {
@@ -63,29 +88,95 @@ func (w *worker) Stop() error {
 }
 
 func (w *worker) consume(ctx context.Context) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if e, ok := r.(error); ok {
-				err = errors.WithStack(e)
-			} else {
-				err = errors.Errorf("panic recovered: %v", r)
-			}
-		}
-	}()
-
 	dequeueCtx, dequeueCancel := context.WithTimeout(ctx, time.Second)
 	defer dequeueCancel()
 	task, err := w.conf.priorityTaskQueue.Dequeue(dequeueCtx)
 	if err != nil {
 		return err
 	}
-
-	handler := taskHandler(task.Key)
-	if handler == nil {
-		return errors.WithStack(ErrTaskHandlerNotFound)
-	}
+	w.lastActiveAt.Store(time.Now().UnixNano())
 
 	taskCtx, taskCancel := context.WithTimeout(ctx, task.Timeout)
 	defer taskCancel()
-	return handler(taskCtx, task)
+
+	w.busy.Store(true)
+	defer w.busy.Store(false)
+
+	inFlight := w.conf.inFlightCounter(task.Key)
+	inFlight.Add(1)
+
+	var handlerErr error
+	var value interface{}
+	hasResult := false
+	if resultHandler := w.conf.resolvedResultHandlers[task.Key]; resultHandler != nil {
+		hasResult = true
+		// 已在 NewWorkerPool 时叠加了 RecoverMiddleware 与全局中间件
+		value, handlerErr = resultHandler(taskCtx, task)
+	} else {
+		// 已在 NewWorkerPool 时叠加了 RecoverMiddleware 与全局/per-handler 中间件
+		handler := w.conf.resolvedHandlers[task.Key]
+		if handler == nil {
+			inFlight.Add(-1)
+			return errors.WithStack(ErrTaskHandlerNotFound)
+		}
+		handlerErr = handler(taskCtx, task)
+	}
+
+	inFlight.Add(-1)
+
+	// 失败且重试次数未耗尽时重新入队,不视为终态,不计入 processed/failed,不产生 TaskResult
+	if handlerErr != nil && task.Attempt < task.MaxRetries {
+		return w.retryTask(ctx, task)
+	}
+
+	w.processed.Add(1)
+	if handlerErr != nil {
+		w.failed.Add(1)
+	}
+
+	if hasResult {
+		w.conf.publishResult(task.ID, &TaskResult{Value: value, Err: handlerErr})
+	}
+
+	if handlerErr != nil && task.MaxRetries > 0 {
+		w.deadLetterTask(ctx, task, handlerErr)
+	}
+
+	return handlerErr
+}
+
+// retryTask 将失败的任务按退避策略延迟后重新入队,并递增其 Attempt
+func (w *worker) retryTask(ctx context.Context, task *Task) error {
+	retryTask := *task
+	retryTask.Attempt++
+
+	backoff := retryTask.RetryBackoff
+	if backoff == nil {
+		backoff = w.conf.DefaultRetryBackoff
+	}
+	if backoff != nil {
+		retryTask.ProcessAt = time.Now().Add(backoff(retryTask.Attempt))
+	}
+
+	queue, ok := w.conf.TaskQueues[retryTask.Queue]
+	if !ok {
+		return errors.WithStack(ErrTaskQueueNotFound)
+	}
+	return queue.Enqueue(ctx, &retryTask)
+}
+
+// deadLetterTask 将重试耗尽的任务投递到 WorkerPoolConfig.DeadLetterQueue
+func (w *worker) deadLetterTask(ctx context.Context, task *Task, handlerErr error) {
+	if w.conf.DeadLetterQueue == "" {
+		return
+	}
+
+	queue, ok := w.conf.TaskQueues[w.conf.DeadLetterQueue]
+	if !ok {
+		w.conf.Logger.Warn(ctx, "dead letter queue %q not found, dropping task %s: %v", w.conf.DeadLetterQueue, task.ID, handlerErr)
+		return
+	}
+	if err := queue.Enqueue(ctx, task); err != nil {
+		w.conf.Logger.Warn(ctx, "failed to move task %s to dead letter queue: %v", task.ID, err)
+	}
 }
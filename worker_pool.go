@@ -13,15 +13,29 @@ import (
 )
 
 type workerPool struct {
-	conf    *WorkerPoolConfig
-	running atomic.Bool
-	workers []Worker
-	mutex   sync.Mutex
+	conf           *WorkerPoolConfig
+	running        atomic.Bool
+	workers        []Worker
+	mutex          sync.Mutex
+	sentinelStopCh chan struct{}
+	sentinelWg     sync.WaitGroup
+	// accepting 为 false 时 Submit 拒绝新任务,由 FlushQueues 临时置位
+	accepting atomic.Bool
 }
 
 type WorkerPoolConfig struct {
-	// WorkerSize 工作协程数量,默认值为 CPU 数量
+	// WorkerSize 已废弃,仅在 MaxWorkers 未设置时作为其默认值,默认值为 CPU 数量
 	WorkerSize uint32
+	// MinWorkers 常驻的最小工作协程数,默认值为 1
+	MinWorkers uint32
+	// MaxWorkers 可扩容到的最大工作协程数,未设置时取 WorkerSize(再未设置则取 CPU 数量)
+	MaxWorkers uint32
+	// WorkerIdleTTL 工作协程的最大空闲时长,超过该时长且当前协程数高于 MinWorkers 时会被回收,默认值为 30 秒
+	WorkerIdleTTL time.Duration
+	// SentinelInterval 哨兵协程巡检空闲工作协程的间隔,默认值为 10 秒
+	SentinelInterval time.Duration
+	// PreSpawn 为 true 时启动即拉起 MaxWorkers 个工作协程,为 false 时从 MinWorkers 起步按需扩容
+	PreSpawn bool
 	// TaskQueue 任务队列实现,如果没传则默认使用 MemoryTaskQueue 内存任务队列,容量1000
 	TaskQueues map[string]TaskQueue
 	// 队列优先级
@@ -33,15 +47,81 @@ type WorkerPoolConfig struct {
 	NewContext func() context.Context
 	// GracefulShutdownTimeout 优雅关闭超时时间,默认值为 5 秒
 	GracefulShutdownTimeout time.Duration
+	// DeadLetterQueue 重试耗尽的任务最终投递到的队列名,需存在于 TaskQueues 中,为空则直接丢弃
+	DeadLetterQueue string
+	// DefaultRetryBackoff 任务重试的默认退避函数,当 task 未通过 WithTaskRetryBackoff 指定时使用
+	//  若为空则重试立即进行,不做退避
+	DefaultRetryBackoff func(attempt int) time.Duration
+	// Middlewares 全局中间件,会在 NewWorkerPool 时叠加到 RecoverMiddleware 与每个已注册
+	//  handler(含其自身通过 RegisterTaskHandlerWithMiddleware 绑定的中间件)之间的最外层
+	Middlewares []TaskMiddleware
 
 	priorityTaskQueue *priorityTaskQueue
+	// resultChans 保存每个待取回任务的结果通道,key 为 task.ID
+	resultChans sync.Map
+	// resolvedHandlers 在 NewWorkerPool 时由 taskHandlers 叠加 Middlewares 计算得到,worker 实际调用的即是它
+	resolvedHandlers map[string]TaskHandler
+	// resolvedResultHandlers 在 NewWorkerPool 时由 taskHandlersWithResult 叠加同一套全局
+	// Middlewares 计算得到,保证带返回值的任务处理器也能享有日志、指标等中间件
+	resolvedResultHandlers map[string]TaskHandlerWithResult
+	// handlerInFlight 记录每个 handler key 当前正在执行的任务数,供 Stats 使用
+	handlerInFlight sync.Map
+}
+
+// inFlightCounter 返回 key 对应的在途任务计数器,不存在则创建
+func (c *WorkerPoolConfig) inFlightCounter(key string) *atomic.Int64 {
+	counter, _ := c.handlerInFlight.LoadOrStore(key, new(atomic.Int64))
+	return counter.(*atomic.Int64)
+}
+
+// TaskHandle Submit 提交任务后返回的句柄,可用于等待任务执行结果
+type TaskHandle struct {
+	ID   string
+	pool *workerPool
+}
+
+// Wait 阻塞等待任务执行完成并返回结果,等价于 pool.WaitForTask(ctx, h.ID)
+func (h *TaskHandle) Wait(ctx context.Context) (*TaskResult, error) {
+	return h.pool.WaitForTask(ctx, h.ID)
+}
+
+// resultChan 返回 id 对应的结果通道,不存在则创建
+func (c *WorkerPoolConfig) resultChan(id string) chan *TaskResult {
+	ch, _ := c.resultChans.LoadOrStore(id, make(chan *TaskResult, 1))
+	return ch.(chan *TaskResult)
+}
+
+// publishResult 由 worker 在 handler 返回后调用,写入结果供 WaitForTask 读取;使用非阻塞发送,
+// 避免同一 task.ID 被重复提交(如复用同一个 *Task)时,尚未被消费的旧结果把 worker goroutine 卡死
+func (c *WorkerPoolConfig) publishResult(id string, result *TaskResult) {
+	select {
+	case c.resultChan(id) <- result:
+	default:
+		c.Logger.Warn(c.NewContext(), "publish result for task %s dropped: previous result not yet consumed", id)
+	}
 }
 
 var _ WorkerPool = &workerPool{}
 
 func NewWorkerPool(conf *WorkerPoolConfig) WorkerPool {
-	if conf.WorkerSize == 0 {
-		conf.WorkerSize = uint32(runtime.GOMAXPROCS(0))
+	if conf.MaxWorkers == 0 {
+		if conf.WorkerSize > 0 {
+			conf.MaxWorkers = conf.WorkerSize
+		} else {
+			conf.MaxWorkers = uint32(runtime.GOMAXPROCS(0))
+		}
+	}
+	if conf.MinWorkers == 0 {
+		conf.MinWorkers = 1
+	}
+	if conf.MinWorkers > conf.MaxWorkers {
+		conf.MinWorkers = conf.MaxWorkers
+	}
+	if conf.WorkerIdleTTL == 0 {
+		conf.WorkerIdleTTL = 30 * time.Second
+	}
+	if conf.SentinelInterval == 0 {
+		conf.SentinelInterval = 10 * time.Second
 	}
 
 	if conf.TaskQueues == nil {
@@ -77,14 +157,33 @@ func NewWorkerPool(conf *WorkerPoolConfig) WorkerPool {
 	}
 	conf.priorityTaskQueue = newPriorityTaskQueue(priorityQueues...)
 
+	// RecoverMiddleware 始终位于全局中间件的最外层,保证 handler panic 不会拖垮 worker
+	globalMiddlewares := append([]TaskMiddleware{RecoverMiddleware()}, conf.Middlewares...)
+	conf.resolvedHandlers = make(map[string]TaskHandler, len(taskHandlers))
+	for key, handler := range taskHandlers {
+		for i := len(globalMiddlewares) - 1; i >= 0; i-- {
+			handler = globalMiddlewares[i](handler)
+		}
+		conf.resolvedHandlers[key] = handler
+	}
+
+	// 带返回值的任务处理器同样套用全局中间件,避免其绕过日志、指标等观测能力
+	conf.resolvedResultHandlers = make(map[string]TaskHandlerWithResult, len(taskHandlersWithResult))
+	for key, handler := range taskHandlersWithResult {
+		conf.resolvedResultHandlers[key] = wrapResultHandlerMiddlewares(handler, globalMiddlewares)
+	}
+
 	return &workerPool{
 		conf: conf,
 	}
 }
 
-func (p *workerPool) Submit(ctx context.Context, task *Task, opts ...TaskOption) error {
+func (p *workerPool) Submit(ctx context.Context, task *Task, opts ...TaskOption) (*TaskHandle, error) {
 	if !p.running.Load() {
-		return errors.New("worker pool is not running")
+		return nil, errors.New("worker pool is not running")
+	}
+	if !p.accepting.Load() {
+		return nil, errors.New("worker pool is flushing queues, not accepting new tasks")
 	}
 
 	// 创建 task 副本避免修改原始 task
@@ -94,35 +193,147 @@ func (p *workerPool) Submit(ctx context.Context, task *Task, opts ...TaskOption)
 		opt(&newTask.TaskOptions)
 	}
 
-	queue, ok := p.conf.TaskQueues[task.Queue]
+	queue, ok := p.conf.TaskQueues[newTask.Queue]
 	if !ok {
-		return errors.WithStack(ErrTaskQueueNotFound)
+		return nil, errors.WithStack(ErrTaskQueueNotFound)
+	}
+
+	if err := queue.Enqueue(ctx, &newTask); err != nil {
+		return nil, err
+	}
+
+	p.growOnDemand(ctx, queue)
+
+	return &TaskHandle{ID: newTask.ID, pool: p}, nil
+}
+
+// growOnDemand 在队列深度超过当前工作协程数时按需扩容一个工作协程,直到 MaxWorkers
+func (p *workerPool) growOnDemand(ctx context.Context, queue TaskQueue) {
+	depth, err := queue.Len(ctx)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if uint32(depth) <= uint32(len(p.workers)) || uint32(len(p.workers)) >= p.conf.MaxWorkers {
+		return
+	}
+
+	if err := p.spawnWorkerLocked(); err != nil {
+		p.conf.Logger.Warn(ctx, "worker pool failed to spawn worker on demand: %v", err)
+	}
+}
+
+// spawnWorkerLocked 启动并登记一个新的工作协程,调用方需已持有 p.mutex
+func (p *workerPool) spawnWorkerLocked() error {
+	worker := newWorker(p.conf)
+	if err := worker.Run(); err != nil {
+		return err
 	}
+	p.workers = append(p.workers, worker)
+	return nil
+}
+
+// WaitForTask 阻塞等待指定 id 的任务完成并返回结果,直到 ctx 被取消
+// 结果被读取或 ctx 取消后,对应的结果通道会被清理
+func (p *workerPool) WaitForTask(ctx context.Context, id string) (*TaskResult, error) {
+	ch := p.conf.resultChan(id)
+	defer p.conf.resultChans.Delete(id)
 
-	return queue.Enqueue(ctx, task)
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func (p *workerPool) Run() error {
 	if !p.running.CompareAndSwap(false, true) {
 		return errors.New("worker pool is running")
 	}
+	p.accepting.Store(true)
 
-	for i, size := 0, p.conf.WorkerSize; i < int(size); i++ {
-		worker := newWorker(p.conf)
-		p.workers = append(p.workers, worker)
-		err := worker.Run()
-		if err != nil {
+	initial := p.conf.MinWorkers
+	if p.conf.PreSpawn {
+		initial = p.conf.MaxWorkers
+	}
+
+	p.mutex.Lock()
+	for i := uint32(0); i < initial; i++ {
+		if err := p.spawnWorkerLocked(); err != nil {
+			p.mutex.Unlock()
 			return err
 		}
 	}
+	p.mutex.Unlock()
+
+	p.sentinelStopCh = make(chan struct{})
+	p.sentinelWg.Add(1)
+	go p.runSentinel()
+
 	return nil
 }
 
+// runSentinel 周期性巡检并回收超过 WorkerIdleTTL 的空闲工作协程,但始终保留至少 MinWorkers 个
+func (p *workerPool) runSentinel() {
+	defer p.sentinelWg.Done()
+
+	ticker := time.NewTicker(p.conf.SentinelInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.sentinelStopCh:
+			return
+		case <-ticker.C:
+			p.reapIdleWorkers()
+		}
+	}
+}
+
+// reapIdleWorkers 选出待回收的空闲工作协程并从 p.workers 摘除,但在释放 p.mutex 之后
+// 才调用 w.Stop(),避免其阻塞至仍在执行中的任务结束而冻结 Submit/growOnDemand/Stats/Resize
+func (p *workerPool) reapIdleWorkers() {
+	p.mutex.Lock()
+
+	removable := len(p.workers) - int(p.conf.MinWorkers)
+	if removable <= 0 {
+		p.mutex.Unlock()
+		return
+	}
+
+	var victims []Worker
+	remaining := p.workers[:0]
+	for _, w := range p.workers {
+		if removable > 0 && !w.Busy() && w.IdleFor() > p.conf.WorkerIdleTTL {
+			victims = append(victims, w)
+			removable--
+			continue
+		}
+		remaining = append(remaining, w)
+	}
+	p.workers = remaining
+
+	p.mutex.Unlock()
+
+	for _, w := range victims {
+		if err := w.Stop(); err != nil {
+			p.conf.Logger.Warn(context.Background(), "worker pool failed to reap idle worker: %v", err)
+		}
+	}
+}
+
 func (p *workerPool) Stop() error {
 	if !p.running.CompareAndSwap(true, false) {
 		return errors.New("worker pool is not running")
 	}
 
+	close(p.sentinelStopCh)
+	p.sentinelWg.Wait()
+
 	ctx := p.conf.NewContext()
 	done := make(chan struct{})
 	var wg sync.WaitGroup
@@ -145,6 +356,11 @@ func (p *workerPool) Stop() error {
 	}()
 
 	// 等待优雅关闭或超时
+	defer p.conf.resultChans.Range(func(key, _ any) bool {
+		p.conf.resultChans.Delete(key)
+		return true
+	})
+
 	select {
 	case <-done:
 		p.conf.Logger.Info(ctx, "worker pool stopped gracefully")
@@ -155,22 +371,29 @@ func (p *workerPool) Stop() error {
 	}
 }
 
+// Resize 将工作协程数手动调整为 workerSize,并被限制在 [MinWorkers, MaxWorkers] 范围内;
+// 哨兵协程仍会继续按 WorkerIdleTTL 回收空闲协程, Submit 仍可能按需扩容,两者共同维持该范围
 func (p *workerPool) Resize(workerSize uint32) error {
-	if workerSize == 0 || workerSize == p.conf.WorkerSize {
-		return nil
+	if workerSize < p.conf.MinWorkers {
+		workerSize = p.conf.MinWorkers
+	}
+	if workerSize > p.conf.MaxWorkers {
+		workerSize = p.conf.MaxWorkers
 	}
 
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	current := uint32(len(p.workers))
+	if workerSize == current {
+		return nil
+	}
+
 	// 缩容
-	if workerSize < p.conf.WorkerSize {
-		for i := workerSize; i < p.conf.WorkerSize; i++ {
-			if i < uint32(len(p.workers)) {
-				err := p.workers[i].Stop()
-				if err != nil {
-					p.conf.Logger.Warn(context.Background(), "worker pool failed to stop worker: %v, idx: %d", err.Error(), i)
-				}
+	if workerSize < current {
+		for i := workerSize; i < current; i++ {
+			if err := p.workers[i].Stop(); err != nil {
+				p.conf.Logger.Warn(context.Background(), "worker pool failed to stop worker: %v, idx: %d", err.Error(), i)
 			}
 		}
 		p.workers = p.workers[:workerSize]
@@ -178,11 +401,8 @@ func (p *workerPool) Resize(workerSize uint32) error {
 	}
 
 	// 扩容
-	for i := p.conf.WorkerSize; i < workerSize; i++ {
-		worker := newWorker(p.conf)
-		p.workers = append(p.workers, worker)
-		err := worker.Run()
-		if err != nil {
+	for i := current; i < workerSize; i++ {
+		if err := p.spawnWorkerLocked(); err != nil {
 			return err
 		}
 	}
@@ -36,7 +36,7 @@ func BenchmarkWorkerPool_Submit(b *testing.B) {
 		for pb.Next() {
 			// 不停丢弃避免OOM
 			_, _ = queue.Dequeue(context.Background())
-			err := pool.Submit(context.Background(), task)
+			_, err := pool.Submit(context.Background(), task)
 			if err != nil {
 				b.Error(err)
 			}
@@ -67,6 +67,12 @@ func (q *fifoTaskQueue) Dequeue(_ context.Context) (*Task, error) {
 	return task, nil
 }
 
+func (q *fifoTaskQueue) Len(_ context.Context) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.data), nil
+}
+
 // BenchmarkWorkerPool_Submit_FIFOQueue 测试任务提交性能（FIFO有锁队列）
 func BenchmarkWorkerPool_Submit_FIFOQueue(b *testing.B) {
 	queue := &fifoTaskQueue{}
@@ -89,7 +95,7 @@ func BenchmarkWorkerPool_Submit_FIFOQueue(b *testing.B) {
 		for pb.Next() {
 			// 不停丢弃避免OOM
 			_, _ = queue.Dequeue(context.Background())
-			err := pool.Submit(context.Background(), task)
+			_, err := pool.Submit(context.Background(), task)
 			if err != nil {
 				b.Error(err)
 			}